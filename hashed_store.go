@@ -0,0 +1,102 @@
+package keyauth
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashedKeyStore resolves a key prefix to its stored bcrypt hash, so a
+// presented key can be verified in O(1) instead of iterating every stored
+// key and comparing in plaintext.
+type HashedKeyStore interface {
+	// Lookup returns the bcrypt hash stored for prefix and the principal
+	// associated with it. ok is false if prefix is not known.
+	Lookup(prefix string) (hash []byte, principal any, ok bool)
+}
+
+// HashedStoreValidatorConfig configures NewHashedStoreValidator.
+type HashedStoreValidatorConfig struct {
+	// PrincipalContextKey is the c.Locals key the resolved principal is
+	// stored under on success. Set this to cfg.ContextKey+"_principal"
+	// to match the ContextKey passed to keyauth.New.
+	// Optional. Default: "token_principal".
+	PrincipalContextKey string
+}
+
+// NewHashedStoreValidator returns a Validator suitable for Config.Validator
+// that expects keys in the "<prefix>.<secret>" form (as with modern
+// personal access tokens): it looks up the bcrypt hash for prefix in store
+// and compares it against secret with bcrypt.CompareHashAndPassword. On
+// success, the resolved principal is exposed via
+// c.Locals(config.PrincipalContextKey, principal).
+//
+// This replaces the `key == storedKey` string comparisons used throughout
+// this package's tests: those leak timing information and require storing
+// keys in plaintext, whereas this validator only ever stores and compares
+// bcrypt hashes.
+func NewHashedStoreValidator(store HashedKeyStore, config ...HashedStoreValidatorConfig) func(*fiber.Ctx, string) (bool, error) {
+	var cfg HashedStoreValidatorConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.PrincipalContextKey == "" {
+		cfg.PrincipalContextKey = "token_principal"
+	}
+
+	return func(c *fiber.Ctx, key string) (bool, error) {
+		prefix, secret, ok := strings.Cut(key, ".")
+		if !ok {
+			return false, ErrMissingOrMalformedAPIKey
+		}
+
+		hash, principal, ok := store.Lookup(prefix)
+		if !ok {
+			return false, ErrMissingOrMalformedAPIKey
+		}
+
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(secret)); err != nil {
+			return false, ErrMissingOrMalformedAPIKey
+		}
+
+		c.Locals(cfg.PrincipalContextKey, principal)
+		return true, nil
+	}
+}
+
+// MemoryHashedKeyStore is an in-memory HashedKeyStore, primarily useful
+// for tests.
+type MemoryHashedKeyStore struct {
+	entries map[string]memoryHashedKeyEntry
+}
+
+type memoryHashedKeyEntry struct {
+	hash      []byte
+	principal any
+}
+
+// NewMemoryHashedKeyStore returns an empty MemoryHashedKeyStore.
+func NewMemoryHashedKeyStore() *MemoryHashedKeyStore {
+	return &MemoryHashedKeyStore{entries: make(map[string]memoryHashedKeyEntry)}
+}
+
+// Add hashes secret with bcrypt and stores it under prefix, associated
+// with principal.
+func (s *MemoryHashedKeyStore) Add(prefix, secret string, principal any) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	s.entries[prefix] = memoryHashedKeyEntry{hash: hash, principal: principal}
+	return nil
+}
+
+// Lookup implements HashedKeyStore.
+func (s *MemoryHashedKeyStore) Lookup(prefix string) ([]byte, any, bool) {
+	entry, ok := s.entries[prefix]
+	if !ok {
+		return nil, nil, false
+	}
+	return entry.hash, entry.principal, true
+}
@@ -0,0 +1,75 @@
+package keyauth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+func TestHashedStoreValidator(t *testing.T) {
+	store := NewMemoryHashedKeyStore()
+	if err := store.Add("abc123", "s3cret", "user-42"); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Validator: NewHashedStoreValidator(store),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("token_principal").(string))
+	})
+
+	tests := []struct {
+		description  string
+		key          string
+		expectedCode int
+	}{
+		{"valid prefix and secret", "abc123.s3cret", http.StatusOK},
+		{"unknown prefix", "unknown.s3cret", http.StatusUnauthorized},
+		{"wrong secret", "abc123.wrong", http.StatusUnauthorized},
+		{"malformed key with no separator", "abc123", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer "+test.key)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.AssertEqual(t, test.expectedCode, res.StatusCode, test.description)
+	}
+}
+
+func TestHashedStoreValidatorCustomContextKey(t *testing.T) {
+	store := NewMemoryHashedKeyStore()
+	if err := store.Add("abc123", "s3cret", "user-42"); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(New(Config{
+		ContextKey: "apikey",
+		Validator: NewHashedStoreValidator(store, HashedStoreValidatorConfig{
+			PrincipalContextKey: "apikey_principal",
+		}),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("apikey_principal").(string))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer abc123.s3cret")
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	utils.AssertEqual(t, "user-42", string(body))
+}
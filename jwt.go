@@ -0,0 +1,396 @@
+package keyauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTOptions configures NewJWTValidator.
+type JWTOptions struct {
+	// PublicKeyPEM is a static PEM-encoded RSA or EC public key used to
+	// verify tokens. Mutually exclusive with JWKSURL.
+	// Optional.
+	PublicKeyPEM []byte
+
+	// JWKSURL is a remote JWKS endpoint keys are fetched from, dispatched
+	// by the token's "kid" header. Mutually exclusive with PublicKeyPEM.
+	// Optional.
+	JWKSURL string
+
+	// JWKSRefreshInterval is how often the JWKS is refreshed in the
+	// background, regardless of whether an unknown kid was seen.
+	// Optional. Default: 1 hour.
+	JWKSRefreshInterval time.Duration
+
+	// JWKSMinRefreshInterval is the minimum time between two JWKS
+	// refreshes triggered by an unknown "kid", to prevent a flood of
+	// unknown kids from hammering the JWKS endpoint.
+	// Optional. Default: 5 seconds.
+	JWKSMinRefreshInterval time.Duration
+
+	// HTTPClient is used to fetch JWKSURL.
+	// Optional. Default: &http.Client{Timeout: 5 * time.Second}.
+	HTTPClient *http.Client
+
+	// AllowedAlgorithms is the set of JWT "alg" values accepted.
+	// "none" is always rejected, and any HS* algorithm is rejected
+	// whenever PublicKeyPEM or JWKSURL is configured: HMACSecret must be
+	// set instead, and is used to verify HS* tokens standalone.
+	// Optional. Default: []string{"RS256", "ES256"}.
+	AllowedAlgorithms []string
+
+	// HMACSecret verifies tokens signed with an HS* algorithm. Required
+	// whenever AllowedAlgorithms contains an HS* value; mutually
+	// exclusive with PublicKeyPEM and JWKSURL.
+	// Optional.
+	HMACSecret []byte
+
+	// Issuer, when set, is required to match the token's "iss" claim.
+	// Optional.
+	Issuer string
+
+	// Audience, when set, is required to be present in the token's "aud"
+	// claim.
+	// Optional.
+	Audience string
+
+	// ClockSkew is the leeway allowed when validating "exp"/"nbf"/"iat".
+	// Optional. Default: 0.
+	ClockSkew time.Duration
+
+	// ScopeClaim is the claim holding the token's scopes, stored in
+	// c.Locals(ScopeContextKey) on success.
+	// Optional. Default: "scope".
+	ScopeClaim string
+
+	// ClaimsContextKey is the c.Locals key the parsed claims map is stored
+	// under on success. Set this to cfg.ContextKey+"_claims" to match the
+	// ContextKey passed to keyauth.New.
+	// Optional. Default: "token_claims".
+	ClaimsContextKey string
+
+	// ScopeContextKey is the c.Locals key the ScopeClaim value is stored
+	// under on success, when present.
+	// Optional. Default: "token_scope".
+	ScopeContextKey string
+}
+
+// NewJWTValidator returns a Validator that treats the extracted credential
+// as a signed JWT and verifies it against either a static public key or a
+// JWKS endpoint, and a stop function that must be called to release the
+// background JWKS refresh goroutine once the validator is no longer
+// needed (a no-op when opts.JWKSURL is unset). On success, the parsed
+// claims are stored under c.Locals(opts.ClaimsContextKey) and, when
+// present, the ScopeClaim value is stored under
+// c.Locals(opts.ScopeContextKey).
+func NewJWTValidator(opts JWTOptions) (validator func(*fiber.Ctx, string) (bool, error), stop func()) {
+	if len(opts.AllowedAlgorithms) == 0 {
+		opts.AllowedAlgorithms = []string{"RS256", "ES256"}
+	}
+	if opts.ScopeClaim == "" {
+		opts.ScopeClaim = "scope"
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if opts.JWKSRefreshInterval == 0 {
+		opts.JWKSRefreshInterval = time.Hour
+	}
+	if opts.JWKSMinRefreshInterval == 0 {
+		opts.JWKSMinRefreshInterval = 5 * time.Second
+	}
+	if opts.ClaimsContextKey == "" {
+		opts.ClaimsContextKey = "token_claims"
+	}
+	if opts.ScopeContextKey == "" {
+		opts.ScopeContextKey = "token_scope"
+	}
+
+	usesPublicKey := len(opts.PublicKeyPEM) > 0 || opts.JWKSURL != ""
+	usesHS := false
+	for _, alg := range opts.AllowedAlgorithms {
+		if len(alg) >= 2 && alg[:2] == "HS" {
+			usesHS = true
+			break
+		}
+	}
+	if usesHS && usesPublicKey {
+		panic("keyauth: HS* algorithms are not allowed alongside a public key or JWKS")
+	}
+	if usesHS && len(opts.HMACSecret) == 0 {
+		panic("keyauth: HMACSecret is required when AllowedAlgorithms contains an HS* algorithm")
+	}
+
+	var staticKey any
+	if len(opts.PublicKeyPEM) > 0 {
+		key, err := parsePublicKeyPEM(opts.PublicKeyPEM)
+		if err != nil {
+			panic(fmt.Sprintf("keyauth: invalid PublicKeyPEM: %v", err))
+		}
+		staticKey = key
+	}
+
+	var jwks *jwksCache
+	stop = func() {}
+	if opts.JWKSURL != "" {
+		jwks = newJWKSCache(opts.JWKSURL, opts.HTTPClient, opts.JWKSMinRefreshInterval)
+		jwks.startBackgroundRefresh(opts.JWKSRefreshInterval)
+		stop = jwks.stop
+	}
+
+	parser := jwt.NewParser(jwt.WithValidMethods(opts.AllowedAlgorithms), jwt.WithLeeway(opts.ClockSkew))
+
+	validator = func(c *fiber.Ctx, token string) (bool, error) {
+		claims := jwt.MapClaims{}
+		parsed, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+			if t.Method == jwt.SigningMethodNone {
+				return nil, fmt.Errorf("keyauth: alg \"none\" is not allowed")
+			}
+			if staticKey != nil {
+				return staticKey, nil
+			}
+			if jwks != nil {
+				kid, _ := t.Header["kid"].(string)
+				return jwks.getKey(kid)
+			}
+			if len(opts.HMACSecret) > 0 {
+				return opts.HMACSecret, nil
+			}
+			return nil, fmt.Errorf("keyauth: no verification key configured")
+		})
+		if err != nil || !parsed.Valid {
+			return false, ErrMissingOrMalformedAPIKey
+		}
+
+		if opts.Issuer != "" {
+			if iss, _ := claims.GetIssuer(); iss != opts.Issuer {
+				return false, ErrMissingOrMalformedAPIKey
+			}
+		}
+		if opts.Audience != "" {
+			aud, _ := claims.GetAudience()
+			if !containsString(aud, opts.Audience) {
+				return false, ErrMissingOrMalformedAPIKey
+			}
+		}
+
+		c.Locals(opts.ClaimsContextKey, map[string]any(claims))
+		if scope, ok := claims[opts.ScopeClaim]; ok {
+			c.Locals(opts.ScopeContextKey, scope)
+		}
+		return true, nil
+	}
+	return validator, stop
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePublicKeyPEM parses a PEM-encoded RSA or EC public key.
+func parsePublicKeyPEM(pemBytes []byte) (crypto.PublicKey, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(pemBytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported or invalid public key")
+}
+
+// jwksCache fetches and caches a JWKS, refreshing on an unknown kid no
+// more often than minRefreshInterval and falling back to the last known
+// key set if the endpoint is unavailable.
+type jwksCache struct {
+	url                string
+	client             *http.Client
+	minRefreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	lastFetch time.Time
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+func newJWKSCache(url string, client *http.Client, minRefreshInterval time.Duration) *jwksCache {
+	return &jwksCache{
+		url:                url,
+		client:             client,
+		minRefreshInterval: minRefreshInterval,
+		stopCh:             make(chan struct{}),
+	}
+}
+
+// startBackgroundRefresh periodically refreshes the JWKS regardless of
+// whether an unknown kid was seen, so rotated keys become known ahead of
+// a token actually using them. The goroutine exits once stop is called.
+func (j *jwksCache) startBackgroundRefresh(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stopCh:
+				return
+			case <-ticker.C:
+				_ = j.refresh()
+			}
+		}
+	}()
+}
+
+// stop releases the background refresh goroutine started by
+// startBackgroundRefresh. It is safe to call more than once.
+func (j *jwksCache) stop() {
+	j.stopOnce.Do(func() {
+		close(j.stopCh)
+	})
+}
+
+func (j *jwksCache) getKey(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	key, ok := j.keys[kid]
+	if ok {
+		j.mu.Unlock()
+		return key, nil
+	}
+
+	if !j.lastFetch.IsZero() && time.Since(j.lastFetch) < j.minRefreshInterval {
+		j.mu.Unlock()
+		return nil, fmt.Errorf("keyauth: unknown kid %q and JWKS refresh is rate limited", kid)
+	}
+	// Record the attempt before fetching, so a failing endpoint is not
+	// hit again on every unknown kid.
+	j.lastFetch = time.Now()
+	j.mu.Unlock()
+
+	if err := j.refresh(); err != nil {
+		j.mu.Lock()
+		_, stillKnown := j.keys[kid]
+		j.mu.Unlock()
+		if stillKnown {
+			key, _ = j.getCachedKey(kid)
+			return key, nil
+		}
+		return nil, fmt.Errorf("keyauth: JWKS refresh failed and kid %q is unknown: %w", kid, err)
+	}
+
+	return j.getCachedKey(kid)
+}
+
+func (j *jwksCache) getCachedKey(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("keyauth: unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func (j *jwksCache) refresh() error {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("keyauth: JWKS endpoint returned %d", resp.StatusCode)
+	}
+
+	var set jwkSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.lastFetch = time.Now()
+	j.mu.Unlock()
+	return nil
+}
+
+// jwk is a single entry of a JSON Web Key Set.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		eInt := 0
+		for _, b := range e {
+			eInt = eInt<<8 + int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: eInt}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("keyauth: unsupported EC curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("keyauth: unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,280 @@
+package keyauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func generateTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func publicKeyPEM(t *testing.T, key *rsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTValidatorStaticKey(t *testing.T) {
+	key := generateTestRSAKey(t)
+
+	validator, stop := NewJWTValidator(JWTOptions{
+		PublicKeyPEM: publicKeyPEM(t, key),
+		Issuer:       "https://issuer.example",
+		Audience:     "my-api",
+	})
+	defer stop()
+
+	app := fiber.New()
+	app.Use(New(Config{Validator: validator}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		claims := c.Locals("token_claims").(map[string]any)
+		return c.SendString(claims["sub"].(string))
+	})
+
+	token := signTestToken(t, key, "", jwt.MapClaims{
+		"iss": "https://issuer.example",
+		"aud": "my-api",
+		"sub": "user-42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+
+	// Wrong audience is rejected.
+	badToken := signTestToken(t, key, "", jwt.MapClaims{
+		"iss": "https://issuer.example",
+		"aud": "other-api",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+badToken)
+	res, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestJWTValidatorRejectsNoneAlgorithm(t *testing.T) {
+	key := generateTestRSAKey(t)
+
+	validator, stop := NewJWTValidator(JWTOptions{PublicKeyPEM: publicKeyPEM(t, key)})
+	defer stop()
+
+	app := fiber.New()
+	app.Use(New(Config{Validator: validator}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+signed)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestJWTValidatorJWKS(t *testing.T) {
+	key := generateTestRSAKey(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwkSet{Keys: []jwk{
+			{
+				Kty: "RSA",
+				Kid: "key-1",
+				N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(bigIntToBytes(key.PublicKey.E)),
+			},
+		}})
+	}))
+	defer ts.Close()
+
+	validator, stop := NewJWTValidator(JWTOptions{JWKSURL: ts.URL})
+	defer stop()
+
+	app := fiber.New()
+	app.Use(New(Config{Validator: validator}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	token := signTestToken(t, key, "key-1", jwt.MapClaims{
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+
+	// A token signed with an unknown kid is rejected.
+	otherKey := generateTestRSAKey(t)
+	unknown := signTestToken(t, otherKey, "key-2", jwt.MapClaims{
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+unknown)
+	res, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestJWTValidatorCustomContextKeys(t *testing.T) {
+	key := generateTestRSAKey(t)
+
+	validator, stop := NewJWTValidator(JWTOptions{
+		PublicKeyPEM:     publicKeyPEM(t, key),
+		ClaimsContextKey: "apikey_claims",
+		ScopeContextKey:  "apikey_scope",
+	})
+	defer stop()
+
+	app := fiber.New()
+	app.Use(New(Config{ContextKey: "apikey", Validator: validator}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		if _, ok := c.Locals("token_claims").(map[string]any); ok {
+			t.Error("claims must not be stored under the default context key")
+		}
+		claims := c.Locals("apikey_claims").(map[string]any)
+		scope := c.Locals("apikey_scope").(string)
+		return c.SendString(claims["sub"].(string) + ":" + scope)
+	})
+
+	token := signTestToken(t, key, "", jwt.MapClaims{
+		"sub":   "user-42",
+		"scope": "read write",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	utils.AssertEqual(t, "user-42:read write", string(body))
+}
+
+func TestJWTValidatorHMACSecret(t *testing.T) {
+	secret := []byte("my-hmac-secret")
+
+	validator, stop := NewJWTValidator(JWTOptions{
+		AllowedAlgorithms: []string{"HS256"},
+		HMACSecret:        secret,
+	})
+	defer stop()
+
+	app := fiber.New()
+	app.Use(New(Config{Validator: validator}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		claims := c.Locals("token_claims").(map[string]any)
+		return c.SendString(claims["sub"].(string))
+	})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+signed)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+
+	// Signed with the wrong secret is rejected.
+	badSigned, err := token.SignedString([]byte("wrong-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+badSigned)
+	res, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestJWTValidatorHMACSecretRequired(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected a panic when HS* is allowed without an HMACSecret")
+		}
+	}()
+	NewJWTValidator(JWTOptions{AllowedAlgorithms: []string{"HS256"}})
+}
+
+func bigIntToBytes(i int) []byte {
+	if i == 0 {
+		return []byte{0}
+	}
+	var b []byte
+	for i > 0 {
+		b = append([]byte{byte(i & 0xff)}, b...)
+		i >>= 8
+	}
+	return b
+}
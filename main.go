@@ -1,172 +1,244 @@
 // 🚀 Fiber is an Express inspired web framework written in Go with 💖
 // 📌 API Documentation: https://fiber.wiki
 // 📝 Github Repository: https://github.com/gofiber/fiber
+// Special thanks to Echo: https://github.com/labstack/echo/blob/master/middleware/key_auth.go
 package keyauth
 
 import (
+	"encoding/hex"
 	"errors"
+	"math"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/gofiber/fiber"
+	"github.com/gofiber/fiber/v2"
 )
 
-// Config ...
+var (
+	// When there is no request of the key thrown ErrMissingOrMalformedAPIKey
+	ErrMissingOrMalformedAPIKey = errors.New("missing or malformed API Key")
+
+	// ErrTooManyRequests is returned when Config.Policy rejects a key
+	// because it is rate limited.
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+// KeyPolicy is consulted after Validator succeeds and before
+// SuccessHandler, so it can apply per-key rules such as rate limiting or
+// revocation without needing to re-extract the key itself. keyHash is a
+// SHA-256 hash of the presented key, never the raw key.
+type KeyPolicy interface {
+	Check(c *fiber.Ctx, keyHash string) (allowed bool, retryAfter time.Duration, err error)
+}
+
 type Config struct {
 	// Filter defines a function to skip middleware.
 	// Optional. Default: nil
 	Filter func(*fiber.Ctx) bool
 
-	// TokenLookup is a string in the form of "<source>:<name>" that is used
-	// to extract token from the request.
-	// Optional. Default value "header:authorization".
+	// SuccessHandler defines a function which is executed for a valid key.
+	// Optional. Default: nil
+	SuccessHandler fiber.Handler
+
+	// ErrorHandler defines a function which is executed for an invalid key.
+	// It may be used to define a custom error.
+	// Optional. Default: 401 Invalid or expired key, or 429 for ErrTooManyRequests
+	ErrorHandler fiber.ErrorHandler
+
+	// KeyLookup is a string in the form of "<source>:<name>" that is used
+	// to extract key from the request.
+	// Optional. Default value "header:Authorization".
 	// Possible values:
 	// - "header:<name>"
 	// - "query:<name>"
-	// - "param:<name>"
 	// - "form:<name>"
+	// - "param:<name>"
 	// - "cookie:<name>"
-	TokenLookup string
+	//
+	// Multiple lookups can be chained with a comma so the middleware tries
+	// each of them in order, e.g. "header:Authorization,header:X-API-Key,query:api_key".
+	// The first source that yields a non-empty candidate is passed to Validator;
+	// sources that yield nothing are skipped, but a candidate that fails
+	// Validator is not retried against the remaining sources.
+	KeyLookup string
 
-	// Validator defines a function you can pass
-	// to check the token however you want
-	// It will be called with the token
-	// and is expected to return true or false to indicate
-	// that the token is approved or not
+	// AuthScheme to be used in the Authorization header.
+	// Optional. Default value "Bearer".
+	AuthScheme string
+
+	// Validator is a function to validate key.
+	Validator func(*fiber.Ctx, string) (bool, error)
+
+	// Policy is consulted after Validator succeeds and before
+	// SuccessHandler. It can be used to rate limit or revoke individual
+	// keys without duplicating key extraction.
 	// Optional. Default: nil
-	Validator func(string) bool
+	Policy KeyPolicy
 
 	// Context key to store the bearertoken from the token into context.
 	// Optional. Default: "token".
 	ContextKey string
-
-	// AuthScheme to be used in the Authorization header.
-	// Optional. Default: "Bearer".
-	AuthScheme string
-
-	// SuccessHandler defines a function which is executed for a valid token.
-	// Optional. Default: c.Next()
-	SuccessHandler func(*fiber.Ctx)
-
-	// ErrorHandler defines a function which is executed for an invalid or missing token.
-	// It may be used to define a custom error.
-	// Optional. Default: 401 Unauthorized
-	ErrorHandler func(*fiber.Ctx, error)
 }
 
-// New creates a middleware for use in Fiber.
-func New(config ...Config) func(*fiber.Ctx) {
+// New ...
+func New(config ...Config) fiber.Handler {
 	// Init config
 	var cfg Config
 	if len(config) > 0 {
 		cfg = config[0]
 	}
-	if cfg.TokenLookup == "" {
-		cfg.TokenLookup = "header:" + fiber.HeaderAuthorization
-	}
-	if cfg.Validator == nil {
-		cfg.Validator = func(t string) bool {
-			return true
-		}
-	}
-	if cfg.ContextKey == "" {
-		cfg.ContextKey = "token"
-	}
-	if cfg.AuthScheme == "" && strings.ToLower(cfg.TokenLookup) == "header:authorization" {
-		cfg.AuthScheme = "Bearer"
-	}
+
 	if cfg.SuccessHandler == nil {
-		cfg.SuccessHandler = func(c *fiber.Ctx) {
-			c.Next()
+		cfg.SuccessHandler = func(c *fiber.Ctx) error {
+			return c.Next()
 		}
 	}
 	if cfg.ErrorHandler == nil {
-		cfg.ErrorHandler = func(c *fiber.Ctx, err error) {
-			c.SendStatus(401)
+		cfg.ErrorHandler = func(c *fiber.Ctx, err error) error {
+			if err == ErrTooManyRequests {
+				return c.Status(fiber.StatusTooManyRequests).SendString(err.Error())
+			}
+			if err == ErrMissingOrMalformedAPIKey {
+				return c.Status(fiber.StatusUnauthorized).SendString(err.Error())
+			}
+			return c.Status(fiber.StatusUnauthorized).SendString("Invalid or expired API Key")
+		}
+	}
+	if cfg.KeyLookup == "" {
+		cfg.KeyLookup = "header:" + fiber.HeaderAuthorization
+		// set AuthScheme as "Bearer" only if KeyLookup is set to default.
+		if cfg.AuthScheme == "" {
+			cfg.AuthScheme = "Bearer"
 		}
 	}
+	if cfg.Validator == nil {
+		panic("fiber: keyauth middleware requires a validator function")
+	}
+	if cfg.ContextKey == "" {
+		cfg.ContextKey = "token"
+	}
+
 	// Initialize
-	parts := strings.Split(cfg.TokenLookup, ":")
-	extractor := tokenFromHeader(parts[1], cfg.AuthScheme)
-	switch parts[0] {
-	case "query":
-		extractor = tokenFromQuery(parts[1])
-	case "param":
-		extractor = tokenFromParam(parts[1])
-	case "form":
-		extractor = tokenFromForm(parts[1])
-	case "cookie":
-		extractor = tokenFromCookie(parts[1])
+	lookups := strings.Split(cfg.KeyLookup, ",")
+	extractors := make([]func(c *fiber.Ctx) (string, error), len(lookups))
+	for i, lookup := range lookups {
+		parts := strings.Split(strings.TrimSpace(lookup), ":")
+		extractor := keyFromHeader(parts[1], cfg.AuthScheme)
+		switch parts[0] {
+		case "query":
+			extractor = keyFromQuery(parts[1])
+		case "form":
+			extractor = keyFromForm(parts[1])
+		case "param":
+			extractor = keyFromParam(parts[1])
+		case "cookie":
+			extractor = keyFromCookie(parts[1])
+		}
+		extractors[i] = extractor
 	}
 
-	return func(c *fiber.Ctx) {
+	// Return middleware handler
+	return func(c *fiber.Ctx) error {
 		// Filter request to skip middleware
 		if cfg.Filter != nil && cfg.Filter(c) {
-			c.Next()
-			return
+			return c.Next()
 		}
-		// Extract bearer token
-		token, err := extractor(c)
-		if !cfg.Validator(token) {
-			cfg.ErrorHandler(c, err)
-			return
+
+		// Try each extractor in order, falling through to the next one only
+		// when the current source yielded no candidate at all. A candidate
+		// that fails Validator is not retried against the remaining sources,
+		// so a bad key in one source can't be shadowed by a good one in another.
+		for _, extractor := range extractors {
+			key, err := extractor(c)
+			if err != nil || key == "" {
+				continue
+			}
+
+			valid, err := cfg.Validator(c, key)
+			if err != nil || !valid {
+				return cfg.ErrorHandler(c, err)
+			}
+
+			if cfg.Policy != nil {
+				keyHash := hex.EncodeToString(sha256Sum(key))
+				allowed, retryAfter, err := cfg.Policy.Check(c, keyHash)
+				if err != nil {
+					return cfg.ErrorHandler(c, err)
+				}
+				if !allowed {
+					if retryAfter > 0 {
+						c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+						return cfg.ErrorHandler(c, ErrTooManyRequests)
+					}
+					return cfg.ErrorHandler(c, ErrMissingOrMalformedAPIKey)
+				}
+			}
+
+			c.Locals(cfg.ContextKey, key)
+			return cfg.SuccessHandler(c)
 		}
-		c.Locals(cfg.ContextKey, token)
-		cfg.SuccessHandler(c)
+
+		return cfg.ErrorHandler(c, ErrMissingOrMalformedAPIKey)
 	}
 }
 
-// tokenFromHeader returns a function that extracts token from the request header.
-func tokenFromHeader(header string, authScheme string) func(c *fiber.Ctx) (string, error) {
+// keyFromHeader returns a function that extracts api key from the request header.
+func keyFromHeader(header string, authScheme string) func(c *fiber.Ctx) (string, error) {
 	return func(c *fiber.Ctx) (string, error) {
 		auth := c.Get(header)
 		l := len(authScheme)
+		if len(auth) > 0 && l == 0 {
+			return auth, nil
+		}
 		if len(auth) > l+1 && auth[:l] == authScheme {
 			return auth[l+1:], nil
 		}
-		return "", errors.New("Missing or malformed Bearer token")
+		return "", ErrMissingOrMalformedAPIKey
 	}
 }
 
-// tokenFromQuery returns a function that extracts token from the query string.
-func tokenFromQuery(param string) func(c *fiber.Ctx) (string, error) {
+// keyFromQuery returns a function that extracts api key from the query string.
+func keyFromQuery(param string) func(c *fiber.Ctx) (string, error) {
 	return func(c *fiber.Ctx) (string, error) {
-		token := c.Query(param)
-		if token == "" {
-			return "", errors.New("Missing or malformed Bearer token")
+		key := c.Query(param)
+		if key == "" {
+			return "", ErrMissingOrMalformedAPIKey
 		}
-		return token, nil
+		return key, nil
 	}
 }
 
-// tokenFromParam returns a function that extracts token from the url param string.
-func tokenFromParam(param string) func(c *fiber.Ctx) (string, error) {
+// keyFromForm returns a function that extracts api key from the form.
+func keyFromForm(param string) func(c *fiber.Ctx) (string, error) {
 	return func(c *fiber.Ctx) (string, error) {
-		token := c.Params(param)
-		if token == "" {
-			return "", errors.New("Missing or malformed Bearer token")
+		key := c.FormValue(param)
+		if key == "" {
+			return "", ErrMissingOrMalformedAPIKey
 		}
-		return token, nil
+		return key, nil
 	}
 }
 
-// tokenFromParam returns a function that extracts token from the url param string.
-func tokenFromForm(param string) func(c *fiber.Ctx) (string, error) {
+// keyFromParam returns a function that extracts api key from the url param string.
+func keyFromParam(param string) func(c *fiber.Ctx) (string, error) {
 	return func(c *fiber.Ctx) (string, error) {
-		token := c.FormValue(param)
-		if token == "" {
-			return "", errors.New("Missing or malformed Bearer token")
+		key, err := url.PathUnescape(c.Params(param))
+		if err != nil {
+			return "", ErrMissingOrMalformedAPIKey
 		}
-		return token, nil
+		return key, nil
 	}
 }
 
-// tokenFromCookie returns a function that extracts token from the named cookie.
-func tokenFromCookie(name string) func(c *fiber.Ctx) (string, error) {
+// keyFromCookie returns a function that extracts api key from the named cookie.
+func keyFromCookie(name string) func(c *fiber.Ctx) (string, error) {
 	return func(c *fiber.Ctx) (string, error) {
-		token := c.Cookies(name)
-		if token == "" {
-			return "", errors.New("Missing or malformed Bearer token")
+		key := c.Cookies(name)
+		if key == "" {
+			return "", ErrMissingOrMalformedAPIKey
 		}
-		return token, nil
+		return key, nil
 	}
 }
@@ -5,7 +5,8 @@
 package keyauth
 
 import (
-	"io/ioutil"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -15,22 +16,11 @@ import (
 	"github.com/gofiber/fiber/v2/utils"
 )
 
-
-func validateAPIKey(ctx *fiber.Ctx, s string) (bool, error) {
-	if s == "" {
-	  return false, &fiber.Error{Code: 403, Message: "Missing API key"}
-	}
-	if s == "valid-key" {
-	  return true, nil
-	}
-	return false, &fiber.Error{Code: 403, Message: "Invalid API key"}
-}
+const CorrectKey = "specials: !$%,.#\"!?~`<>@$^*(){}[]|/\\123"
 
 func TestAuthSources(t *testing.T) {
-
-	var CorrectKey = "specials: !$%,.#\"!?~`<>@$^*(){}[]|/\\123"
 	// define test cases
-	testSources := []string {"header", "cookie", "query", "param", "form"}
+	testSources := []string{"header", "cookie", "query", "param", "form"}
 
 	tests := []struct {
 		route         string
@@ -66,7 +56,6 @@ func TestAuthSources(t *testing.T) {
 		},
 	}
 
-
 	for _, authSource := range testSources {
 		t.Run(authSource, func(t *testing.T) {
 			for _, test := range tests {
@@ -76,8 +65,8 @@ func TestAuthSources(t *testing.T) {
 				app := fiber.New(fiber.Config{UnescapePath: true})
 
 				authMiddleware := New(Config{
-					KeyLookup:  authSource + ":" + test.authTokenName,
-					Validator:  func(c *fiber.Ctx, key string) (bool, error) {
+					KeyLookup: authSource + ":" + test.authTokenName,
+					Validator: func(c *fiber.Ctx, key string) (bool, error) {
 						if key == CorrectKey {
 							return true, nil
 						}
@@ -101,7 +90,7 @@ func TestAuthSources(t *testing.T) {
 				// construct the test HTTP request
 				var req *http.Request
 				req, _ = http.NewRequest("GET", test.route, nil)
-				
+
 				// setup the apikey for the different auth schemes
 				if authSource == "header" {
 
@@ -109,7 +98,7 @@ func TestAuthSources(t *testing.T) {
 
 				} else if authSource == "cookie" {
 
-					req.Header.Set("Cookie", test.authTokenName + "=" + test.APIKey)
+					req.Header.Set("Cookie", test.authTokenName+"="+test.APIKey)
 
 				} else if authSource == "query" || authSource == "form" {
 
@@ -130,8 +119,8 @@ func TestAuthSources(t *testing.T) {
 				utils.AssertEqual(t, nil, err, test.description)
 
 				// test the body of the request
-				body, err := ioutil.ReadAll(res.Body)
-				// for param authentication, the route would be /:access_token 
+				body, err := io.ReadAll(res.Body)
+				// for param authentication, the route would be /:access_token
 				// when the access_token is empty, it leads to a 404 (not found)
 				// not a 401 (auth error)
 				if authSource == "param" && test.APIKey == "" {
@@ -148,9 +137,7 @@ func TestAuthSources(t *testing.T) {
 	}
 }
 
-
 func TestMultipleKeyAuth(t *testing.T) {
-
 	// setup the fiber endpoint
 	app := fiber.New()
 
@@ -160,7 +147,7 @@ func TestMultipleKeyAuth(t *testing.T) {
 			return c.OriginalURL() != "/auth1"
 		},
 		KeyLookup: "header:key",
-		Validator:  func(c *fiber.Ctx, key string) (bool, error) {
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
 			if key == "password1" {
 				return true, nil
 			}
@@ -174,7 +161,7 @@ func TestMultipleKeyAuth(t *testing.T) {
 			return c.OriginalURL() != "/auth2"
 		},
 		KeyLookup: "header:key",
-		Validator:  func(c *fiber.Ctx, key string) (bool, error) {
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
 			if key == "password2" {
 				return true, nil
 			}
@@ -196,7 +183,7 @@ func TestMultipleKeyAuth(t *testing.T) {
 
 	// define test cases
 	tests := []struct {
-		route 		 string
+		route        string
 		description  string
 		APIKey       string
 		expectedCode int
@@ -210,7 +197,7 @@ func TestMultipleKeyAuth(t *testing.T) {
 			expectedCode: 200,
 			expectedBody: "No auth needed!",
 		},
-		
+
 		// auth needed for auth1
 		{
 			route:        "/auth1",
@@ -271,7 +258,7 @@ func TestMultipleKeyAuth(t *testing.T) {
 		utils.AssertEqual(t, nil, err, test.description)
 
 		// test the body of the request
-		body, err := ioutil.ReadAll(res.Body)
+		body, err := io.ReadAll(res.Body)
 		utils.AssertEqual(t, test.expectedCode, res.StatusCode, test.description)
 
 		// body
@@ -281,17 +268,21 @@ func TestMultipleKeyAuth(t *testing.T) {
 }
 
 func TestCustomSuccessAndFailureHandlers(t *testing.T) {
-	// Initialize a Fiber app with the KeyAuth middleware
-	// Use the KeyAuth middleware with the default configuration and custom SuccessHandler and ErrorHandler functions
 	app := fiber.New()
+
 	app.Use(New(Config{
 		SuccessHandler: func(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusOK).SendString("API key is valid and request was handled by custom success handler")
 		},
-		ErrorHandler:func(c *fiber.Ctx, err error) error {
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			return c.Status(fiber.StatusUnauthorized).SendString("API key is invalid and request was handled by custom error handler")
 		},
-		Validator: validateAPIKey,
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
+			if key == CorrectKey {
+				return true, nil
+			}
+			return false, ErrMissingOrMalformedAPIKey
+		},
 	}))
 
 	// Define a test handler that should not be called
@@ -307,15 +298,15 @@ func TestCustomSuccessAndFailureHandlers(t *testing.T) {
 	}
 
 	// Read the response body into a string
-	body, _ := ioutil.ReadAll(res.Body)
+	body, _ := io.ReadAll(res.Body)
 
 	// Check that the response has the expected status code and body
 	utils.AssertEqual(t, res.StatusCode, http.StatusUnauthorized)
-    utils.AssertEqual(t, string(body), "API key is invalid and request was handled by custom error handler")
+	utils.AssertEqual(t, string(body), "API key is invalid and request was handled by custom error handler")
 
 	// Create a request with a valid API key in the Authorization header
 	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Add("Authorization", "Bearer valid-key")
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", CorrectKey))
 
 	// Send the request to the app
 	res, err = app.Test(req)
@@ -324,66 +315,26 @@ func TestCustomSuccessAndFailureHandlers(t *testing.T) {
 	}
 
 	// Read the response body into a string
-	body, _ = ioutil.ReadAll(res.Body)
+	body, _ = io.ReadAll(res.Body)
 
 	// Check that the response has the expected status code and body
 	utils.AssertEqual(t, res.StatusCode, http.StatusOK)
-    utils.AssertEqual(t, string(body), "API key is valid and request was handled by custom success handler")
-}
-
-func TestCustomValidatorFunc(t *testing.T) {
-	// Initialize a Fiber app with the KeyAuth middleware
-	app := fiber.New()
-
-	// Use the KeyAuth middleware with a custom Validator function
-	app.Use(New(Config{
-		Validator: validateAPIKey,
-	}))
-
-	// Define a test handler
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.SendString("API key is valid")
-	})
-
-	// Create a request with an invalid API key and send it to the app
-	res, err := app.Test(httptest.NewRequest("GET", "/", nil))
-	if err != nil {
-		t.Error(err)
-	}
-
-	// Read the response body into a string
-	body, _ := ioutil.ReadAll(res.Body)
-
-	// Check that the response has the expected status code and body
-	utils.AssertEqual(t, res.StatusCode, http.StatusUnauthorized)
-    utils.AssertEqual(t, string(body), ErrMissingOrMalformedAPIKey.Error())
-
-	// Create a request with a valid API key and send it to the app
-	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Add("Authorization", "Bearer valid-key")
-	res, err = app.Test(req)
-	if err != nil {
-		t.Error(err)
-	}
-
-	// Read the response body into a string
-	body, _ = ioutil.ReadAll(res.Body)
-
-	// Check that the response has the expected status code and body
-	utils.AssertEqual(t, res.StatusCode, http.StatusOK)
-    utils.AssertEqual(t, string(body), "API key is valid")
+	utils.AssertEqual(t, string(body), "API key is valid and request was handled by custom success handler")
 }
 
 func TestCustomFilterFunc(t *testing.T) {
-	// Initialize a Fiber app with the KeyAuth middleware
-	// Use the KeyAuth middleware with a custom Filter function that only allows requests with the "/allowed" path
 	app := fiber.New()
 
 	app.Use(New(Config{
 		Filter: func(c *fiber.Ctx) bool {
 			return c.Path() == "/allowed"
 		},
-		Validator: validateAPIKey,
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
+			if key == CorrectKey {
+				return true, nil
+			}
+			return false, ErrMissingOrMalformedAPIKey
+		},
 	}))
 
 	// Define a test handler
@@ -399,13 +350,13 @@ func TestCustomFilterFunc(t *testing.T) {
 	}
 
 	// Read the response body into a string
-	body, _ := ioutil.ReadAll(res.Body)
+	body, _ := io.ReadAll(res.Body)
 
 	// Check that the response has the expected status code and body
 	utils.AssertEqual(t, res.StatusCode, http.StatusOK)
-    utils.AssertEqual(t, string(body), "API key is valid and request was allowed by custom filter")
+	utils.AssertEqual(t, string(body), "API key is valid and request was allowed by custom filter")
 
-	// Create a request with a different path and send it to the app
+	// Create a request with a different path and send it to the app without correct key
 	req = httptest.NewRequest("GET", "/not-allowed", nil)
 	res, err = app.Test(req)
 	if err != nil {
@@ -413,20 +364,40 @@ func TestCustomFilterFunc(t *testing.T) {
 	}
 
 	// Read the response body into a string
-	body, _ = ioutil.ReadAll(res.Body)
+	body, _ = io.ReadAll(res.Body)
 
 	// Check that the response has the expected status code and body
 	utils.AssertEqual(t, res.StatusCode, http.StatusUnauthorized)
-    utils.AssertEqual(t, string(body), ErrMissingOrMalformedAPIKey.Error())
+	utils.AssertEqual(t, string(body), ErrMissingOrMalformedAPIKey.Error())
+
+	// Create a request with a different path and send it to the app with correct key
+	req = httptest.NewRequest("GET", "/not-allowed", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Basic %s", CorrectKey))
+
+	res, err = app.Test(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Read the response body into a string
+	body, _ = io.ReadAll(res.Body)
+
+	// Check that the response has the expected status code and body
+	utils.AssertEqual(t, res.StatusCode, http.StatusUnauthorized)
+	utils.AssertEqual(t, string(body), ErrMissingOrMalformedAPIKey.Error())
 }
 
 func TestAuthSchemeToken(t *testing.T) {
-	// Initialize a Fiber app with the KeyAuth middleware
-	// Use the KeyAuth middleware with the "AuthScheme: Token" configuration
 	app := fiber.New()
+
 	app.Use(New(Config{
 		AuthScheme: "Token",
-		Validator: validateAPIKey,
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
+			if key == CorrectKey {
+				return true, nil
+			}
+			return false, ErrMissingOrMalformedAPIKey
+		},
 	}))
 
 	// Define a test handler
@@ -436,7 +407,7 @@ func TestAuthSchemeToken(t *testing.T) {
 
 	// Create a request with a valid API key in the "Token" Authorization header
 	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Add("Authorization", "Token valid-key")
+	req.Header.Add("Authorization", fmt.Sprintf("Token %s", CorrectKey))
 
 	// Send the request to the app
 	res, err := app.Test(req)
@@ -445,21 +416,25 @@ func TestAuthSchemeToken(t *testing.T) {
 	}
 
 	// Read the response body into a string
-	body, _ := ioutil.ReadAll(res.Body)
+	body, _ := io.ReadAll(res.Body)
 
 	// Check that the response has the expected status code and body
 	utils.AssertEqual(t, res.StatusCode, http.StatusOK)
-    utils.AssertEqual(t, string(body), "API key is valid")
+	utils.AssertEqual(t, string(body), "API key is valid")
 }
 
 func TestAuthSchemeBasic(t *testing.T) {
-	// Initialize a Fiber app with the KeyAuth middleware
-	// Use the KeyAuth middleware with the "header:Authorization" and "Basic" configuration
 	app := fiber.New()
+
 	app.Use(New(Config{
-		KeyLookup: "header:Authorization",
+		KeyLookup:  "header:Authorization",
 		AuthScheme: "Basic",
-		Validator: validateAPIKey,
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
+			if key == CorrectKey {
+				return true, nil
+			}
+			return false, ErrMissingOrMalformedAPIKey
+		},
 	}))
 
 	// Define a test handler
@@ -474,15 +449,15 @@ func TestAuthSchemeBasic(t *testing.T) {
 	}
 
 	// Read the response body into a string
-	body, _ := ioutil.ReadAll(res.Body)
+	body, _ := io.ReadAll(res.Body)
 
 	// Check that the response has the expected status code and body
 	utils.AssertEqual(t, res.StatusCode, http.StatusUnauthorized)
-    utils.AssertEqual(t, string(body), ErrMissingOrMalformedAPIKey.Error())
+	utils.AssertEqual(t, string(body), ErrMissingOrMalformedAPIKey.Error())
 
 	// Create a request with a valid API key in the "Authorization" header using the "Basic" scheme
 	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Add("Authorization", "Basic valid-key")
+	req.Header.Add("Authorization", fmt.Sprintf("Basic %s", CorrectKey))
 
 	// Send the request to the app
 	res, err = app.Test(req)
@@ -491,10 +466,74 @@ func TestAuthSchemeBasic(t *testing.T) {
 	}
 
 	// Read the response body into a string
-	body, _ = ioutil.ReadAll(res.Body)
+	body, _ = io.ReadAll(res.Body)
 
 	// Check that the response has the expected status code and body
 	utils.AssertEqual(t, res.StatusCode, http.StatusOK)
-    utils.AssertEqual(t, string(body), "API key is valid")
+	utils.AssertEqual(t, string(body), "API key is valid")
 }
 
+func TestMultipleKeyLookup(t *testing.T) {
+	// Initialize a Fiber app with the KeyAuth middleware configured to
+	// accept the key from either the Authorization header or a X-API-Key
+	// header, falling back to a query parameter.
+	app := fiber.New()
+	app.Use(New(Config{
+		KeyLookup: "header:Authorization,header:X-API-Key,query:api_key",
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
+			if key == CorrectKey {
+				return true, nil
+			}
+			return false, ErrMissingOrMalformedAPIKey
+		},
+	}))
+
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("API key is valid")
+	})
+
+	// No key on any source: falls through every extractor and reports missing.
+	res, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Error(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	utils.AssertEqual(t, http.StatusUnauthorized, res.StatusCode)
+	utils.AssertEqual(t, ErrMissingOrMalformedAPIKey.Error(), string(body))
+
+	// Authorization header is empty, X-API-Key carries the key: falls
+	// through to the second extractor since the first yielded nothing.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("X-API-Key", CorrectKey)
+	res, err = app.Test(req)
+	if err != nil {
+		t.Error(err)
+	}
+	body, _ = io.ReadAll(res.Body)
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+	utils.AssertEqual(t, "API key is valid", string(body))
+
+	// Neither header is set, but the query fallback carries the key.
+	req = httptest.NewRequest("GET", "/?api_key="+url.QueryEscape(CorrectKey), nil)
+	res, err = app.Test(req)
+	if err != nil {
+		t.Error(err)
+	}
+	body, _ = io.ReadAll(res.Body)
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+	utils.AssertEqual(t, "API key is valid", string(body))
+
+	// Authorization header carries a wrong key: validation fails on the
+	// first non-empty source and must not fall through to X-API-Key, even
+	// though X-API-Key holds a correct one (no credential-shadowing).
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", "wrong-key"))
+	req.Header.Add("X-API-Key", CorrectKey)
+	res, err = app.Test(req)
+	if err != nil {
+		t.Error(err)
+	}
+	body, _ = io.ReadAll(res.Body)
+	utils.AssertEqual(t, http.StatusUnauthorized, res.StatusCode)
+	utils.AssertEqual(t, ErrMissingOrMalformedAPIKey.Error(), string(body))
+}
@@ -0,0 +1,79 @@
+package keyauth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tokenBucketPolicy is a per-key token-bucket rate limiter, keyed on the
+// SHA-256 hash passed to Check so raw keys never enter its map.
+type tokenBucketPolicy struct {
+	rate  float64 // tokens added per `per`
+	burst float64
+	per   time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketPolicy returns a KeyPolicy that allows at most burst
+// requests at once for a given key, refilling at rate tokens per per.
+func NewTokenBucketPolicy(rate, burst int, per time.Duration) KeyPolicy {
+	return &tokenBucketPolicy{
+		rate:    float64(rate),
+		burst:   float64(burst),
+		per:     per,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (p *tokenBucketPolicy) Check(c *fiber.Ctx, keyHash string) (bool, time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	b, ok := p.buckets[keyHash]
+	if !ok {
+		b = &tokenBucket{tokens: p.burst, last: now}
+		p.buckets[keyHash] = b
+	}
+
+	elapsed := now.Sub(b.last)
+	b.tokens = min(p.burst, b.tokens+elapsed.Seconds()*p.rate/p.per.Seconds())
+	b.last = now
+
+	if b.tokens < 1 {
+		missing := 1 - b.tokens
+		retryAfter := time.Duration(missing * p.per.Seconds() / p.rate * float64(time.Second))
+		return false, retryAfter, nil
+	}
+
+	b.tokens--
+	return true, 0, nil
+}
+
+// revocationListPolicy rejects keys found in an external revocation list.
+type revocationListPolicy struct {
+	isRevoked func(keyHash string) bool
+}
+
+// NewRevocationListPolicy returns a KeyPolicy that rejects any key whose
+// hash isRevoked reports as revoked, with a 401 response (no Retry-After,
+// since revocation isn't a transient condition).
+func NewRevocationListPolicy(isRevoked func(keyHash string) bool) KeyPolicy {
+	return &revocationListPolicy{isRevoked: isRevoked}
+}
+
+func (p *revocationListPolicy) Check(c *fiber.Ctx, keyHash string) (bool, time.Duration, error) {
+	if p.isRevoked(keyHash) {
+		return false, 0, nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,110 @@
+package keyauth
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+func newKeyauthApp(t *testing.T, policy KeyPolicy) *fiber.App {
+	t.Helper()
+	app := fiber.New()
+	app.Use(New(Config{
+		Policy: policy,
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
+			if key == CorrectKey {
+				return true, nil
+			}
+			return false, ErrMissingOrMalformedAPIKey
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func TestTokenBucketPolicy(t *testing.T) {
+	app := newKeyauthApp(t, NewTokenBucketPolicy(1, 2, time.Minute))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer "+CorrectKey)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+	}
+
+	// Burst is exhausted: the third request in quick succession is rate limited.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+CorrectKey)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusTooManyRequests, res.StatusCode)
+	if res.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Error("expected Retry-After header to be set")
+	}
+}
+
+func TestTokenBucketPolicySubSecondRetryAfter(t *testing.T) {
+	// rate=10/s means the per-token deficit after burst is exhausted is
+	// well under a second; Retry-After must still round up to at least 1.
+	app := newKeyauthApp(t, NewTokenBucketPolicy(10, 1, time.Second))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+CorrectKey)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+
+	// Burst is exhausted: the very next request is rate limited.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+CorrectKey)
+	res, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusTooManyRequests, res.StatusCode)
+	retryAfter := res.Header.Get(fiber.HeaderRetryAfter)
+	if retryAfter == "" || retryAfter == "0" {
+		t.Errorf("expected a non-zero Retry-After header, got %q", retryAfter)
+	}
+}
+
+func TestRevocationListPolicy(t *testing.T) {
+	revoked := map[string]bool{}
+	policy := NewRevocationListPolicy(func(keyHash string) bool {
+		return revoked[keyHash]
+	})
+	app := newKeyauthApp(t, policy)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+CorrectKey)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+
+	keyHash := hex.EncodeToString(sha256Sum(CorrectKey))
+	revoked[keyHash] = true
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+CorrectKey)
+	res, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusUnauthorized, res.StatusCode)
+}
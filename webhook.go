@@ -0,0 +1,220 @@
+package keyauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// WebhookValidatorConfig configures NewWebhookValidator.
+type WebhookValidatorConfig struct {
+	// URL is the endpoint the presented key is POSTed to for a decision.
+	// Required.
+	URL string
+
+	// Secret, when set, is used to sign the outgoing request body with
+	// HMAC-SHA256. The hex-encoded signature is sent in the X-Signature
+	// header so the webhook can verify the request originated from this
+	// middleware.
+	// Optional. Default: no signature.
+	Secret []byte
+
+	// Client is the http.Client used to call URL.
+	// Optional. Default: &http.Client{Timeout: 5 * time.Second}.
+	Client *http.Client
+
+	// MaxRetries is the number of additional attempts made after a 5xx
+	// response or network error, using exponential backoff starting at
+	// RetryBackoff.
+	// Optional. Default: 2.
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry; it doubles after
+	// each subsequent attempt.
+	// Optional. Default: 100ms.
+	RetryBackoff time.Duration
+
+	// CacheTTL is how long a successful decision is cached in memory,
+	// keyed by a SHA-256 hash of the presented key so raw keys are never
+	// retained. Set to 0 to disable caching.
+	// Optional. Default: 0 (disabled).
+	CacheTTL time.Duration
+
+	// PrincipalContextKey is the c.Locals key the resolved principal is
+	// stored under on success.
+	// Optional. Default: "webhook_principal".
+	PrincipalContextKey string
+
+	// ScopesContextKey is the c.Locals key the resolved scopes are stored
+	// under on success.
+	// Optional. Default: "webhook_scopes".
+	ScopesContextKey string
+}
+
+// webhookRequest is the JSON body POSTed to WebhookValidatorConfig.URL.
+type webhookRequest struct {
+	Key       string `json:"key"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	RemoteIP  string `json:"remote_ip"`
+	RequestID string `json:"request_id"`
+}
+
+// webhookResponse is the expected JSON response from the webhook.
+type webhookResponse struct {
+	Allow     bool     `json:"allow"`
+	Principal string   `json:"principal"`
+	Scopes    []string `json:"scopes"`
+}
+
+type webhookCacheEntry struct {
+	resp      webhookResponse
+	expiresAt time.Time
+}
+
+// NewWebhookValidator returns a Validator that delegates the allow/deny
+// decision to an external policy service. It is suitable for
+// Config.Validator.
+func NewWebhookValidator(cfg WebhookValidatorConfig) func(*fiber.Ctx, string) (bool, error) {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 2
+	}
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = 100 * time.Millisecond
+	}
+	if cfg.PrincipalContextKey == "" {
+		cfg.PrincipalContextKey = "webhook_principal"
+	}
+	if cfg.ScopesContextKey == "" {
+		cfg.ScopesContextKey = "webhook_scopes"
+	}
+
+	var mu sync.Mutex
+	cache := make(map[string]webhookCacheEntry)
+
+	return func(c *fiber.Ctx, key string) (bool, error) {
+		keyHash := hex.EncodeToString(sha256Sum(key))
+
+		if cfg.CacheTTL > 0 {
+			mu.Lock()
+			entry, ok := cache[keyHash]
+			mu.Unlock()
+			if ok && time.Now().Before(entry.expiresAt) {
+				return applyWebhookResponse(c, cfg, entry.resp)
+			}
+		}
+
+		resp, err := callWebhook(c, cfg, key)
+		if err != nil {
+			return false, err
+		}
+
+		if cfg.CacheTTL > 0 && resp.Allow {
+			mu.Lock()
+			cache[keyHash] = webhookCacheEntry{resp: resp, expiresAt: time.Now().Add(cfg.CacheTTL)}
+			mu.Unlock()
+		}
+
+		return applyWebhookResponse(c, cfg, resp)
+	}
+}
+
+// applyWebhookResponse stores the principal/scopes returned by the webhook
+// in c.Locals and translates the decision into the Validator contract.
+func applyWebhookResponse(c *fiber.Ctx, cfg WebhookValidatorConfig, resp webhookResponse) (bool, error) {
+	if !resp.Allow {
+		return false, ErrMissingOrMalformedAPIKey
+	}
+	c.Locals(cfg.PrincipalContextKey, resp.Principal)
+	c.Locals(cfg.ScopesContextKey, resp.Scopes)
+	return true, nil
+}
+
+// callWebhook POSTs the key and request metadata to cfg.URL, retrying on
+// network errors and 5xx responses with exponential backoff.
+func callWebhook(c *fiber.Ctx, cfg WebhookValidatorConfig, key string) (webhookResponse, error) {
+	requestID := c.Get(fiber.HeaderXRequestID)
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+
+	body, err := json.Marshal(webhookRequest{
+		Key:       key,
+		Method:    c.Method(),
+		Path:      c.Path(),
+		RemoteIP:  c.IP(),
+		RequestID: requestID,
+	})
+	if err != nil {
+		return webhookResponse{}, err
+	}
+
+	backoff := cfg.RetryBackoff
+	var lastErr error
+	for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		resp, err := doWebhookRequest(cfg, body, requestID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("webhook: server returned %d", resp.StatusCode)
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != fiber.StatusOK {
+			return webhookResponse{}, fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+		}
+
+		var out webhookResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return webhookResponse{}, err
+		}
+		return out, nil
+	}
+
+	return webhookResponse{}, fmt.Errorf("webhook: request failed after %d attempts: %w", cfg.MaxRetries+1, lastErr)
+}
+
+func doWebhookRequest(cfg WebhookValidatorConfig, body []byte, requestID string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(fiber.HeaderXRequestID, requestID)
+	if len(cfg.Secret) > 0 {
+		req.Header.Set("X-Signature", signWebhookBody(cfg.Secret, body))
+	}
+	return cfg.Client.Do(req)
+}
+
+// signWebhookBody returns the hex-encoded HMAC-SHA256 of body using secret.
+func signWebhookBody(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func sha256Sum(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
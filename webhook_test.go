@@ -0,0 +1,158 @@
+package keyauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+func TestWebhookValidatorSuccess(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		utils.AssertEqual(t, CorrectKey, req.Key)
+
+		json.NewEncoder(w).Encode(webhookResponse{
+			Allow:     true,
+			Principal: "user-42",
+			Scopes:    []string{"read", "write"},
+		})
+	}))
+	defer ts.Close()
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Validator: NewWebhookValidator(WebhookValidatorConfig{URL: ts.URL}),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("webhook_principal").(string))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+CorrectKey)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+}
+
+func TestWebhookValidatorDeny(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(webhookResponse{Allow: false})
+	}))
+	defer ts.Close()
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Validator: NewWebhookValidator(WebhookValidatorConfig{URL: ts.URL}),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("should not reach here")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+CorrectKey)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestWebhookValidatorRetriesOn5xx(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(webhookResponse{Allow: true, Principal: "user-42"})
+	}))
+	defer ts.Close()
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Validator: NewWebhookValidator(WebhookValidatorConfig{
+			URL:          ts.URL,
+			MaxRetries:   2,
+			RetryBackoff: time.Millisecond,
+		}),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+CorrectKey)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+	utils.AssertEqual(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestWebhookValidatorCachesSuccess(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		json.NewEncoder(w).Encode(webhookResponse{Allow: true, Principal: "user-42"})
+	}))
+	defer ts.Close()
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Validator: NewWebhookValidator(WebhookValidatorConfig{URL: ts.URL, CacheTTL: time.Minute}),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer "+CorrectKey)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+	}
+	utils.AssertEqual(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestWebhookValidatorSignsBody(t *testing.T) {
+	secret := []byte("shh")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+		sig := r.Header.Get("X-Signature")
+		utils.AssertEqual(t, signWebhookBody(secret, body), sig)
+		json.NewEncoder(w).Encode(webhookResponse{Allow: true})
+	}))
+	defer ts.Close()
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Validator: NewWebhookValidator(WebhookValidatorConfig{URL: ts.URL, Secret: secret}),
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer "+CorrectKey)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.AssertEqual(t, http.StatusOK, res.StatusCode)
+}